@@ -0,0 +1,305 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// electionState tracks the per-service leader-election goroutine started by
+// the controller, keyed by the same namespace/name key used for the
+// workqueue so a delete event (which no longer has the Service object to
+// read a UID from) can still find and stop it.
+type electionState struct {
+	cancel    context.CancelFunc
+	candidate EndpointCandidate
+}
+
+// endpointController reconciles Services and EndpointSlices from a pair of
+// shared informer caches instead of spawning a RetryWatcher per Service. This
+// mirrors the upstream kube-controller-manager endpoints controller: informer
+// event handlers enqueue namespace/name keys into a rate-limited workqueue,
+// and a fixed pool of workers drains it, resolving desired state from the
+// caches rather than from the event itself.
+type endpointController struct {
+	sm *Manager
+
+	informerFactory       informers.SharedInformerFactory
+	serviceInformer       cache.SharedIndexInformer
+	endpointSliceInformer cache.SharedIndexInformer
+
+	queue workqueue.RateLimitingInterface
+
+	nodeID   string
+	nodeZone string
+	wg       *sync.WaitGroup
+
+	mu        sync.Mutex
+	elections map[string]*electionState
+}
+
+// newEndpointController wires up the Service and EndpointSlice informers and
+// their event handlers. resync is the informer resync period. The number of
+// goroutines that drain the queue is not set here but passed to Run
+// (operators tune it via --concurrent-service-syncs).
+func (sm *Manager) newEndpointController(nodeID string, wg *sync.WaitGroup, resync time.Duration) *endpointController {
+	factory := informers.NewSharedInformerFactory(sm.clientSet, resync)
+
+	c := &endpointController{
+		sm:                    sm,
+		informerFactory:       factory,
+		serviceInformer:       factory.Core().V1().Services().Informer(),
+		endpointSliceInformer: factory.Discovery().V1().EndpointSlices().Informer(),
+		queue:                 workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		nodeID:                nodeID,
+		nodeZone:              sm.nodeZone(context.Background(), nodeID),
+		wg:                    wg,
+		elections:             make(map[string]*electionState),
+	}
+
+	c.serviceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueService,
+		UpdateFunc: func(_, newObj interface{}) { c.enqueueService(newObj) },
+		DeleteFunc: c.enqueueService,
+	})
+
+	c.endpointSliceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueOwningService,
+		UpdateFunc: func(_, newObj interface{}) { c.enqueueOwningService(newObj) },
+		DeleteFunc: c.enqueueOwningService,
+	})
+
+	return c
+}
+
+func (c *endpointController) enqueueService(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Errorf("[controller] couldn't get key for object: %v", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueOwningService resolves an EndpointSlice back to the Service key it
+// belongs to (via the kubernetes.io/service-name label) and enqueues that
+// instead, since EndpointSlices are sharded and never reconciled directly.
+func (c *endpointController) enqueueOwningService(obj interface{}) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			slice, ok = tombstone.Obj.(*discoveryv1.EndpointSlice)
+			if !ok {
+				return
+			}
+		} else {
+			return
+		}
+	}
+	serviceName, ok := slice.Labels[discoveryv1.LabelServiceName]
+	if !ok {
+		return
+	}
+	c.queue.Add(slice.Namespace + "/" + serviceName)
+}
+
+// Run starts the informers, waits for their caches to sync and then runs
+// workers goroutines until ctx is cancelled or sm.shutdownChan is closed.
+func (c *endpointController) Run(ctx context.Context, workers int) error {
+	defer c.queue.ShutDown()
+
+	c.informerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.serviceInformer.HasSynced, c.endpointSliceInformer.HasSynced) {
+		return fmt.Errorf("timed out waiting for controller caches to sync")
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.sm.shutdownChan:
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer utilruntime.HandleCrash(c.sm.crashHandlers()...)
+			for c.processNextWorkItem(runCtx) {
+			}
+		}()
+	}
+
+	<-runCtx.Done()
+	// Workers are blocked in c.queue.Get(), which only returns once
+	// ShutDown has actually been called - wait for that before wg.Wait(),
+	// or a graceful shutdown with an empty queue deadlocks forever.
+	c.queue.ShutDown()
+	c.stopAllElections()
+	wg.Wait()
+	return nil
+}
+
+func (c *endpointController) processNextWorkItem(ctx context.Context) bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncService(ctx, key.(string)); err != nil {
+		c.queue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("[controller] error syncing %q: %w", key, err))
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// syncService resolves the current desired state for a Service (local
+// endpoints, whether an election should be running) from the informer caches
+// and reconciles it. This replaces the ad-hoc lastKnownGoodEndpoint state
+// machine in watchEndpoint with a single reconcile path per Service.
+func (c *endpointController) syncService(ctx context.Context, key string) error {
+	obj, exists, err := c.serviceInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		c.stopElection(key)
+		return nil
+	}
+	service := obj.(*v1.Service).DeepCopy()
+
+	all, local := c.candidatesForService(service)
+	return c.reconcileElection(ctx, key, service, all, local)
+}
+
+// candidatesForService merges every EndpointSlice owned by service out of
+// the informer cache into the cluster-wide and node-local candidate sets an
+// EndpointSelector needs, filtered to the family the Service prefers.
+func (c *endpointController) candidatesForService(service *v1.Service) (all, local []EndpointCandidate) {
+	slices := make(map[string]*discoveryv1.EndpointSlice)
+	for _, obj := range c.endpointSliceInformer.GetIndexer().List() {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			continue
+		}
+		if slice.Namespace != service.Namespace || slice.Labels[discoveryv1.LabelServiceName] != service.Name {
+			continue
+		}
+		slices[slice.Name] = slice
+	}
+	all = candidatesFromSlices(slices, desiredAddressType(service))
+	local = localCandidates(all, c.nodeID)
+	return all, local
+}
+
+// reconcileElection starts or stops the per-service leader election so that
+// it is running if and only if the Service's EndpointSelector currently
+// picks a local candidate.
+func (c *endpointController) reconcileElection(ctx context.Context, key string, service *v1.Service, all, local []EndpointCandidate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.elections[key]
+	var previous *EndpointCandidate
+	if ok {
+		previous = &state.candidate
+	}
+	selected, eligible := selectorForService(service).Select(c.nodeZone, local, all, previous)
+
+	if !eligible {
+		if ok {
+			state.cancel()
+			delete(c.elections, key)
+			c.sm.recorder.Event(service, v1.EventTypeNormal, EventReasonEndpointLost, "no local endpoints remain")
+		}
+		return nil
+	}
+
+	if ok {
+		if state.candidate.Address == selected.Address {
+			return nil
+		}
+		// The elected endpoint changed out from under us (e.g. it stopped
+		// serving); cancel and let a fresh election pick up the new one.
+		state.cancel()
+		delete(c.elections, key)
+	}
+
+	electionCtx, cancel := context.WithCancel(ctx)
+	c.elections[key] = &electionState{cancel: cancel, candidate: selected}
+
+	c.sm.recorder.Eventf(service, v1.EventTypeNormal, EventReasonEndpointElected, "%s/%s", c.nodeID, selected.Address)
+
+	if service.Annotations["kube-vip.io/egress"] == "true" {
+		service.Annotations["kube-vip.io/active-endpoint"] = selected.Address
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer utilruntime.HandleCrash(c.sm.crashHandlers()...)
+		c.sm.recorder.Event(service, v1.EventTypeNormal, EventReasonLeaderElected, "started leader election")
+		err := c.sm.StartServicesLeaderElection(electionCtx, service, c.wg)
+		c.sm.recorder.Event(service, v1.EventTypeNormal, EventReasonLeaderLost, "leader election ended")
+		if err != nil {
+			utilruntime.HandleError(err)
+		}
+	}()
+
+	return nil
+}
+
+func (c *endpointController) stopElection(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if state, ok := c.elections[key]; ok {
+		state.cancel()
+		delete(c.elections, key)
+	}
+}
+
+func (c *endpointController) stopAllElections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, state := range c.elections {
+		state.cancel()
+		delete(c.elections, key)
+	}
+}
+
+// RunController starts the shared-informer based Service/EndpointSlice
+// controller and blocks until ctx is cancelled. workers sets how many
+// reconcile goroutines run concurrently (--concurrent-service-syncs), and wg
+// is shared with the leader-election goroutines the controller spawns.
+func (sm *Manager) RunController(ctx context.Context, nodeID string, workers int, wg *sync.WaitGroup) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	c := sm.newEndpointController(nodeID, wg, 0)
+	log.Infof("[controller] starting with %d worker(s)", workers)
+	return c.Run(ctx, workers)
+}
+
+// Start is the entry point a kube-vip binary calls once it has a Manager: it
+// runs the shared-informer Service/EndpointSlice controller, using
+// concurrentServiceSyncs (set via WithConcurrentServiceSyncs) as the worker
+// count, and blocks until ctx is cancelled.
+func (sm *Manager) Start(ctx context.Context, nodeID string, wg *sync.WaitGroup) error {
+	return sm.RunController(ctx, nodeID, sm.concurrentServiceSyncs, wg)
+}
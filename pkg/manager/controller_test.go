@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestEndpointControllerRunStopsOnContextCancel guards against Run()
+// deadlocking when ctx is cancelled with an empty queue: the workers are
+// blocked in c.queue.Get(), which only returns once ShutDown() has actually
+// been called, so Run() must call it before wg.Wait() rather than only
+// deferring it.
+func TestEndpointControllerRunStopsOnContextCancel(t *testing.T) {
+	sm := NewManager(fake.NewSimpleClientset(), make(chan struct{}))
+	var wg sync.WaitGroup
+	c := sm.newEndpointController("node-a", &wg, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx, 1)
+	}()
+
+	// Give the controller a moment to start and sync its (empty) caches.
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after ctx was cancelled - workqueue shutdown deadlock?")
+	}
+}
+
+// TestEndpointControllerRunStopsOnShutdownChan guards against Run() ignoring
+// sm.shutdownChan, which its own doc comment promises stops every watch
+// goroutine the Manager started.
+func TestEndpointControllerRunStopsOnShutdownChan(t *testing.T) {
+	shutdownChan := make(chan struct{})
+	sm := NewManager(fake.NewSimpleClientset(), shutdownChan)
+	var wg sync.WaitGroup
+	c := sm.newEndpointController("node-a", &wg, 0)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(context.Background(), 1)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	close(shutdownChan)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after shutdownChan was closed")
+	}
+}
@@ -0,0 +1,13 @@
+package manager
+
+// crashHandlers returns the extra utilruntime.HandleCrash callbacks to run
+// after a Manager goroutine recovers from a panic, including the operator's
+// PanicHandler (if set) alongside the process-wide utilruntime.PanicHandlers.
+// This lets an embedder flush state, detach the VIP cleanly, or bump a
+// Prometheus counter before kube-vip decides whether to re-panic.
+func (sm *Manager) crashHandlers() []func(interface{}) {
+	if sm.PanicHandler == nil {
+		return nil
+	}
+	return []func(interface{}){sm.PanicHandler}
+}
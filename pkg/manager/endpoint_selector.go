@@ -0,0 +1,294 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// EndpointSelectorAnnotation lets a Service opt into a specific failover
+// policy for which local endpoint kube-vip tracks and advertises. One of
+// "FirstReady" (default), "LowestIP", "StickyPodUID" or "TopologyPreferred".
+const EndpointSelectorAnnotation = "kube-vip.io/endpoint-selector"
+
+// EndpointCandidate is a single ready address backing a Service, flattened
+// out of its merged EndpointSlices with enough identity/topology attached
+// for an EndpointSelector to choose deterministically between several.
+type EndpointCandidate struct {
+	Address      string
+	NodeName     string
+	Zone         string
+	TargetRefUID types.UID
+	ForZones     []string
+}
+
+// EndpointSelector decides which EndpointCandidate a node should track and
+// advertise as the Service's active endpoint. local holds only candidates
+// hosted on this node (the existing eligibility gate: a node only enters
+// leader election when it has a local candidate); all holds every ready
+// candidate across the cluster, for strategies that need cluster-wide
+// context such as zone membership. previous is the endpoint that was
+// selected last time (nil on the first call for this Service), so a
+// selector can stay sticky across watch events instead of flapping.
+type EndpointSelector interface {
+	Select(nodeZone string, local, all []EndpointCandidate, previous *EndpointCandidate) (EndpointCandidate, bool)
+}
+
+// selectorForService resolves the EndpointSelector a Service has opted into
+// via EndpointSelectorAnnotation, defaulting to FirstReady when unset or
+// unrecognised.
+func selectorForService(service *v1.Service) EndpointSelector {
+	switch service.Annotations[EndpointSelectorAnnotation] {
+	case "LowestIP":
+		return lowestIPSelector{}
+	case "StickyPodUID":
+		return stickyPodUIDSelector{}
+	case "TopologyPreferred":
+		return topologyPreferredSelector{}
+	default:
+		return firstReadySelector{}
+	}
+}
+
+// sortedByAddress returns a copy of candidates sorted by Address, so
+// "first" is deterministic instead of depending on EndpointSlice/map
+// iteration order.
+func sortedByAddress(candidates []EndpointCandidate) []EndpointCandidate {
+	sorted := make([]EndpointCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Address < sorted[j].Address })
+	return sorted
+}
+
+// firstReadySelector preserves kube-vip's original behaviour of tracking
+// whichever local candidate appears first, except made deterministic by
+// sorting on address rather than trusting watch/map ordering.
+type firstReadySelector struct{}
+
+func (firstReadySelector) Select(_ string, local, _ []EndpointCandidate, _ *EndpointCandidate) (EndpointCandidate, bool) {
+	if len(local) == 0 {
+		return EndpointCandidate{}, false
+	}
+	return sortedByAddress(local)[0], true
+}
+
+// lowestIPSelector always tracks the numerically lowest local address,
+// giving a stable choice that doesn't depend on which endpoint happened to
+// be reported first.
+type lowestIPSelector struct{}
+
+func (lowestIPSelector) Select(_ string, local, _ []EndpointCandidate, _ *EndpointCandidate) (EndpointCandidate, bool) {
+	if len(local) == 0 {
+		return EndpointCandidate{}, false
+	}
+	lowest := local[0]
+	for _, candidate := range local[1:] {
+		if compareIPs(candidate.Address, lowest.Address) < 0 {
+			lowest = candidate
+		}
+	}
+	return lowest, true
+}
+
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a).To16(), net.ParseIP(b).To16()
+	if ipA == nil || ipB == nil {
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+		return 0
+	}
+	for i := range ipA {
+		if ipA[i] != ipB[i] {
+			return int(ipA[i]) - int(ipB[i])
+		}
+	}
+	return 0
+}
+
+// stickyPodUIDSelector keeps tracking the same pod across watch events, as
+// identified by TargetRef.UID, so a pod restarting on the same node doesn't
+// cause an unnecessary VIP flap to a sibling pod. It only picks a new
+// candidate (falling back to the lowest address) once the previously
+// elected pod is gone.
+type stickyPodUIDSelector struct{}
+
+func (stickyPodUIDSelector) Select(_ string, local, _ []EndpointCandidate, previous *EndpointCandidate) (EndpointCandidate, bool) {
+	if len(local) == 0 {
+		return EndpointCandidate{}, false
+	}
+	if previous != nil && previous.TargetRefUID != "" {
+		for _, candidate := range local {
+			if candidate.TargetRefUID == previous.TargetRefUID {
+				return candidate, true
+			}
+		}
+	}
+	return lowestIPSelector{}.Select("", local, nil, nil)
+}
+
+// topologyPreferredSelector prefers advertising from a candidate whose
+// EndpointSlice hints say it serves the node's own zone. If the local
+// candidates aren't hinted for this zone but a same-zone peer exists
+// elsewhere in the cluster, it yields (ok=false) so that peer's node wins
+// the election instead of pinning traffic to a cross-zone hop.
+type topologyPreferredSelector struct{}
+
+func (topologyPreferredSelector) Select(nodeZone string, local, all []EndpointCandidate, previous *EndpointCandidate) (EndpointCandidate, bool) {
+	if len(local) == 0 {
+		return EndpointCandidate{}, false
+	}
+
+	zoneMatched := make([]EndpointCandidate, 0, len(local))
+	for _, candidate := range local {
+		if servesZone(candidate, nodeZone) {
+			zoneMatched = append(zoneMatched, candidate)
+		}
+	}
+	if len(zoneMatched) > 0 {
+		return stickyPodUIDSelector{}.Select(nodeZone, zoneMatched, all, previous)
+	}
+
+	for _, candidate := range all {
+		if candidate.NodeName != local[0].NodeName && candidate.Zone == nodeZone {
+			// A same-zone peer exists elsewhere; let that node's own
+			// TopologyPreferred selection pick it up instead.
+			return EndpointCandidate{}, false
+		}
+	}
+
+	return stickyPodUIDSelector{}.Select(nodeZone, local, all, previous)
+}
+
+// servesZone reports whether a candidate's EndpointSlice hints (if any)
+// say it should receive traffic destined for zone. Candidates without
+// hints are treated as serving every zone, matching EndpointSlice's own
+// "no hint means no restriction" semantics.
+func servesZone(candidate EndpointCandidate, zone string) bool {
+	if len(candidate.ForZones) == 0 {
+		return true
+	}
+	for _, z := range candidate.ForZones {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeZone looks up the topology.kubernetes.io/zone label of the local
+// node, returning "" if the node can't be read or doesn't carry one.
+func (sm *Manager) nodeZone(ctx context.Context, nodeID string) string {
+	node, err := sm.clientSet.CoreV1().Nodes().Get(ctx, nodeID, metav1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	return node.Labels["topology.kubernetes.io/zone"]
+}
+
+// candidatesFromSlices flattens every known EndpointSlice for a Service into
+// ready, non-terminating candidates of the requested address family,
+// without filtering by node - used to build the cluster-wide view an
+// EndpointSelector needs alongside the node-local one.
+func candidatesFromSlices(slices map[string]*discoveryv1.EndpointSlice, addressType discoveryv1.AddressType) []EndpointCandidate {
+	var candidates []EndpointCandidate
+	for _, slice := range slices {
+		if slice.AddressType != addressType {
+			continue
+		}
+		for i := range slice.Endpoints {
+			ep := slice.Endpoints[i]
+			if ep.Conditions.Serving != nil && !*ep.Conditions.Serving {
+				continue
+			}
+			if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+				continue
+			}
+
+			nodeName := ""
+			if ep.NodeName != nil {
+				nodeName = *ep.NodeName
+			} else if hostname, ok := ep.DeprecatedTopology["kubernetes.io/hostname"]; ok {
+				nodeName = hostname
+			}
+
+			zone := ""
+			if ep.Zone != nil {
+				zone = *ep.Zone
+			} else if z, ok := ep.DeprecatedTopology["topology.kubernetes.io/zone"]; ok {
+				zone = z
+			}
+
+			var targetRefUID types.UID
+			if ep.TargetRef != nil {
+				targetRefUID = ep.TargetRef.UID
+			}
+
+			var forZones []string
+			if ep.Hints != nil {
+				for _, z := range ep.Hints.ForZones {
+					forZones = append(forZones, z.Name)
+				}
+			}
+
+			for _, address := range ep.Addresses {
+				candidates = append(candidates, EndpointCandidate{
+					Address:      address,
+					NodeName:     nodeName,
+					Zone:         zone,
+					TargetRefUID: targetRefUID,
+					ForZones:     forZones,
+				})
+			}
+		}
+	}
+	return candidates
+}
+
+// candidatesFromEndpoints flattens a legacy v1.Endpoints object into
+// candidates, for clusters falling back to watchEndpointLegacy. Endpoints
+// carries no zone or per-address hint information, so Zone and ForZones are
+// always left at their zero value - TopologyPreferred degrades to
+// StickyPodUID's behaviour on these clusters.
+func candidatesFromEndpoints(ep *v1.Endpoints) []EndpointCandidate {
+	var candidates []EndpointCandidate
+	for subset := range ep.Subsets {
+		for _, address := range ep.Subsets[subset].Addresses {
+			nodeName := ""
+			if address.NodeName != nil {
+				nodeName = *address.NodeName
+			}
+
+			var targetRefUID types.UID
+			if address.TargetRef != nil {
+				targetRefUID = address.TargetRef.UID
+			}
+
+			candidates = append(candidates, EndpointCandidate{
+				Address:      address.IP,
+				NodeName:     nodeName,
+				TargetRefUID: targetRefUID,
+			})
+		}
+	}
+	return candidates
+}
+
+// localCandidates filters candidates down to the ones hosted on nodeID.
+func localCandidates(candidates []EndpointCandidate, nodeID string) []EndpointCandidate {
+	var local []EndpointCandidate
+	for _, candidate := range candidates {
+		if candidate.NodeName == nodeID {
+			local = append(local, candidate)
+		}
+	}
+	return local
+}
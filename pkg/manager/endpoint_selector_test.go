@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestFirstReadySelector(t *testing.T) {
+	local := []EndpointCandidate{
+		{Address: "10.0.0.2"},
+		{Address: "10.0.0.1"},
+	}
+
+	selected, eligible := firstReadySelector{}.Select("", local, nil, nil)
+	if !eligible {
+		t.Fatal("expected a local candidate to be eligible")
+	}
+	if selected.Address != "10.0.0.1" {
+		t.Errorf("Address = %q, want the lowest-sorted address 10.0.0.1", selected.Address)
+	}
+
+	if _, eligible := (firstReadySelector{}).Select("", nil, nil, nil); eligible {
+		t.Error("expected no local candidates to be ineligible")
+	}
+}
+
+func TestLowestIPSelector(t *testing.T) {
+	local := []EndpointCandidate{
+		{Address: "10.0.0.20"},
+		{Address: "10.0.0.3"},
+		{Address: "10.0.0.100"},
+	}
+
+	selected, eligible := lowestIPSelector{}.Select("", local, nil, nil)
+	if !eligible {
+		t.Fatal("expected a local candidate to be eligible")
+	}
+	if selected.Address != "10.0.0.3" {
+		t.Errorf("Address = %q, want numerically lowest 10.0.0.3", selected.Address)
+	}
+}
+
+func TestStickyPodUIDSelector(t *testing.T) {
+	local := []EndpointCandidate{
+		{Address: "10.0.0.2", TargetRefUID: types.UID("pod-b")},
+		{Address: "10.0.0.1", TargetRefUID: types.UID("pod-a")},
+	}
+
+	t.Run("sticks to the previous pod UID even if it isn't the lowest address", func(t *testing.T) {
+		previous := &EndpointCandidate{Address: "10.0.0.2", TargetRefUID: types.UID("pod-b")}
+		selected, eligible := stickyPodUIDSelector{}.Select("", local, nil, previous)
+		if !eligible {
+			t.Fatal("expected a local candidate to be eligible")
+		}
+		if selected.TargetRefUID != "pod-b" {
+			t.Errorf("TargetRefUID = %q, want sticky pod-b", selected.TargetRefUID)
+		}
+	})
+
+	t.Run("falls back to lowest IP once the previous pod is gone", func(t *testing.T) {
+		previous := &EndpointCandidate{Address: "10.0.0.99", TargetRefUID: types.UID("pod-gone")}
+		selected, eligible := stickyPodUIDSelector{}.Select("", local, nil, previous)
+		if !eligible {
+			t.Fatal("expected a local candidate to be eligible")
+		}
+		if selected.Address != "10.0.0.1" {
+			t.Errorf("Address = %q, want fallback to lowest 10.0.0.1", selected.Address)
+		}
+	})
+}
+
+func TestTopologyPreferredSelector(t *testing.T) {
+	t.Run("prefers a local candidate hinted for the node's zone", func(t *testing.T) {
+		local := []EndpointCandidate{
+			{Address: "10.0.0.1", NodeName: "node-a", ForZones: []string{"zone-b"}},
+			{Address: "10.0.0.2", NodeName: "node-a", ForZones: []string{"zone-a"}},
+		}
+		selected, eligible := topologyPreferredSelector{}.Select("zone-a", local, local, nil)
+		if !eligible {
+			t.Fatal("expected a zone-matched candidate to be eligible")
+		}
+		if selected.Address != "10.0.0.2" {
+			t.Errorf("Address = %q, want the zone-a-hinted candidate 10.0.0.2", selected.Address)
+		}
+	})
+
+	t.Run("yields when a same-zone peer exists elsewhere in the cluster", func(t *testing.T) {
+		local := []EndpointCandidate{
+			{Address: "10.0.0.1", NodeName: "node-a", ForZones: []string{"zone-b"}},
+		}
+		all := append([]EndpointCandidate{
+			{Address: "10.0.0.9", NodeName: "node-c", Zone: "zone-a", ForZones: []string{"zone-a"}},
+		}, local...)
+
+		_, eligible := topologyPreferredSelector{}.Select("zone-a", local, all, nil)
+		if eligible {
+			t.Error("expected to yield to the same-zone peer on node-c")
+		}
+	})
+
+	t.Run("falls back cluster-wide when no same-zone peer exists", func(t *testing.T) {
+		local := []EndpointCandidate{
+			{Address: "10.0.0.1", NodeName: "node-a", ForZones: []string{"zone-b"}},
+		}
+		selected, eligible := topologyPreferredSelector{}.Select("zone-a", local, local, nil)
+		if !eligible {
+			t.Fatal("expected to fall back to the only local candidate")
+		}
+		if selected.Address != "10.0.0.1" {
+			t.Errorf("Address = %q, want fallback candidate 10.0.0.1", selected.Address)
+		}
+	})
+}
+
+func TestCandidatesFromEndpoints(t *testing.T) {
+	// Endpoints carries no zone/hint data, so candidates built from it should
+	// always be eligible for every zone under TopologyPreferred.
+	nodeName := "node-a"
+	candidates := candidatesFromEndpoints(&v1.Endpoints{
+		Subsets: []v1.EndpointSubset{{
+			Addresses: []v1.EndpointAddress{{IP: "10.0.0.1", NodeName: &nodeName}},
+		}},
+	})
+	if len(candidates) != 1 {
+		t.Fatalf("got %d candidates, want 1", len(candidates))
+	}
+	candidate := candidates[0]
+	if candidate.Address != "10.0.0.1" || candidate.NodeName != "node-a" {
+		t.Errorf("candidate = %+v, want Address 10.0.0.1 on node-a", candidate)
+	}
+	if !servesZone(candidate, "any-zone") {
+		t.Error("expected a candidate with no ForZones to serve every zone")
+	}
+}
@@ -0,0 +1,30 @@
+package manager
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons emitted on the Service object for VIP lifecycle transitions.
+// These make `kubectl describe svc` a first-class debugging surface for
+// kube-vip and let any cluster event exporter pick them up.
+const (
+	EventReasonEndpointElected        = "EndpointElected"
+	EventReasonEndpointLost           = "EndpointLost"
+	EventReasonEndpointWatchError     = "EndpointWatchError"
+	EventReasonLeaderElected          = "LeaderElected"
+	EventReasonLeaderLost             = "LeaderLost"
+	EventReasonAnnotationUpdateFailed = "AnnotationUpdateFailed"
+)
+
+// NewEventRecorder builds the record.EventRecorder that Manager uses to emit
+// VIP lifecycle events on Service objects. NewManager calls this to populate
+// the Manager.recorder field.
+func NewEventRecorder(clientSet kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientSet.CoreV1().Events("")})
+	return broadcaster.NewRecorder(clientgoscheme.Scheme, v1.EventSource{Component: "kube-vip"})
+}
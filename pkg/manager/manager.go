@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// Manager reconciles Services against the node's local endpoints and
+// advertises a VIP for whichever one wins leader election. One Manager is
+// constructed per kube-vip instance and shared across every watch goroutine
+// or controller it starts.
+type Manager struct {
+	clientSet kubernetes.Interface
+
+	// shutdownChan is closed to tell every watch goroutine started by this
+	// Manager to stop.
+	shutdownChan chan struct{}
+
+	// recorder emits the VIP lifecycle events (EventReasonEndpointElected,
+	// EventReasonLeaderElected, ...) that watchEndpoint, watchEndpointSlice
+	// and the shared-informer controller record against the Service objects
+	// they reconcile.
+	recorder record.EventRecorder
+
+	// PanicHandler, if set, runs alongside the process-wide
+	// utilruntime.PanicHandlers whenever a Manager goroutine recovers from a
+	// panic - see crashHandlers. Set it with WithPanicHandler.
+	PanicHandler func(interface{})
+
+	// concurrentServiceSyncs is the worker pool size Start passes to
+	// RunController to drain its workqueue. Set it with WithConcurrentServiceSyncs, which is
+	// what the --concurrent-service-syncs flag should be wired to.
+	concurrentServiceSyncs int
+}
+
+// defaultConcurrentServiceSyncs matches kube-controller-manager's own
+// default for --concurrent-service-syncs.
+const defaultConcurrentServiceSyncs = 1
+
+// Option configures optional Manager behaviour at construction time.
+type Option func(*Manager)
+
+// WithPanicHandler sets the PanicHandler an embedder wants run whenever a
+// Manager goroutine recovers from a panic, e.g. to flush state, detach the
+// VIP cleanly or bump a metric before kube-vip decides whether to re-panic.
+func WithPanicHandler(handler func(interface{})) Option {
+	return func(sm *Manager) {
+		sm.PanicHandler = handler
+	}
+}
+
+// WithConcurrentServiceSyncs sets how many workers Start's controller uses
+// to drain its workqueue, overriding defaultConcurrentServiceSyncs.
+func WithConcurrentServiceSyncs(workers int) Option {
+	return func(sm *Manager) {
+		sm.concurrentServiceSyncs = workers
+	}
+}
+
+// NewManager builds a Manager backed by clientSet, wiring up its event
+// recorder before returning.
+func NewManager(clientSet kubernetes.Interface, shutdownChan chan struct{}, opts ...Option) *Manager {
+	sm := &Manager{
+		clientSet:              clientSet,
+		shutdownChan:           shutdownChan,
+		recorder:               NewEventRecorder(clientSet),
+		concurrentServiceSyncs: defaultConcurrentServiceSyncs,
+	}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	return sm
+}
@@ -10,21 +10,50 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
 	watchtools "k8s.io/client-go/tools/watch"
 	"k8s.io/client-go/util/retry"
 )
 
+// watchEndpoint watches a Service's endpoints and reconciles VIP advertisement
+// against the local node. It prefers discovery.k8s.io/v1 EndpointSlices and
+// only falls back to the legacy v1.Endpoints object on clusters where the
+// EndpointSlice API isn't being served.
+//
+// Deprecated: clusters with many LB Services should run sm.Start instead,
+// which shares a single informer cache and workqueue across every Service
+// rather than spawning a watcher per Service. watchEndpoint is kept for
+// single-service callers and tests.
 func (sm *Manager) watchEndpoint(ctx context.Context, id string, service *v1.Service, wg *sync.WaitGroup) error {
+	if sm.discoveryV1Available() {
+		return sm.watchEndpointSlice(ctx, id, service, wg)
+	}
+	log.Infof("[endpoint] EndpointSlice API unavailable, falling back to legacy Endpoints watch for service [%s] in namespace [%s]", service.Name, service.Namespace)
+	return sm.watchEndpointLegacy(ctx, id, service, wg)
+}
+
+// watchEndpointLegacy watches the legacy v1.Endpoints object for a Service.
+// It is retained for clusters older than 1.21 (or with EndpointSlice disabled)
+// that don't serve discovery.k8s.io/v1.
+func (sm *Manager) watchEndpointLegacy(ctx context.Context, id string, service *v1.Service, wg *sync.WaitGroup) error {
 	log.Infof("[endpoint] watching for service [%s] in namespace [%s]", service.Name, service.Namespace)
 	// Use a restartable watcher, as this should help in the event of etcd or timeout issues
 	var cancel context.CancelFunc
-	var endpointContext context.Context
-	endpointContext, cancel = context.WithCancel(context.Background())
-	var electionActive bool
+	var watcherCtx context.Context
+	watcherCtx, cancel = context.WithCancel(context.Background())
 	defer cancel()
 
+	selector := selectorForService(service)
+
+	// lastKnownGoodEndpoint and electionCancel are only ever touched from
+	// this event loop goroutine - the leader-election goroutine started
+	// below owns nothing but its own electionCtx, so there's no shared
+	// mutable state to race on.
+	var lastKnownGoodEndpoint *EndpointCandidate
+	var electionCancel context.CancelFunc
+
 	opts := metav1.ListOptions{
 		FieldSelector: fields.OneTermEqualSelector("metadata.name", service.Name).String(),
 	}
@@ -40,6 +69,7 @@ func (sm *Manager) watchEndpoint(ctx context.Context, id string, service *v1.Ser
 
 	exitFunction := make(chan struct{})
 	go func() {
+		defer utilruntime.HandleCrash(sm.crashHandlers()...)
 		select {
 		case <-sm.shutdownChan:
 			log.Debug("[endpoint] shutdown called")
@@ -60,7 +90,6 @@ func (sm *Manager) watchEndpoint(ctx context.Context, id string, service *v1.Ser
 
 	ch := rw.ResultChan()
 
-	var lastKnownGoodEndpoint string
 	for event := range ch {
 
 		// We need to inspect the event and get ResourceVersion out of it
@@ -71,75 +100,62 @@ func (sm *Manager) watchEndpoint(ctx context.Context, id string, service *v1.Ser
 				cancel()
 				return fmt.Errorf("unable to parse Kubernetes services from API watcher")
 			}
-			// Build endpoints
-			var localendpoints []string
-			for subset := range ep.Subsets {
-				for address := range ep.Subsets[subset].Addresses {
-
-					// Check the node is populated
-					if ep.Subsets[subset].Addresses[address].NodeName != nil {
-						if id == *ep.Subsets[subset].Addresses[address].NodeName {
-							localendpoints = append(localendpoints, ep.Subsets[subset].Addresses[address].IP)
-						}
-					}
-				}
+			all := candidatesFromEndpoints(ep)
+			local := localCandidates(all, id)
+
+			goodAddress := ""
+			if lastKnownGoodEndpoint != nil {
+				goodAddress = lastKnownGoodEndpoint.Address
 			}
-			log.Debugf("[endpoint watcher] local endpoint(s) [%d], last known good [%s], active election [%t]", len(localendpoints), lastKnownGoodEndpoint, electionActive)
-
-			stillExists := false
-			if len(localendpoints) != 0 {
-				if lastKnownGoodEndpoint == "" {
-					lastKnownGoodEndpoint = localendpoints[0]
-					// Create new context
-					//endpointContext, cancel = context.WithCancel(context.Background()) //nolint:govet
-					//defer cancel()                                                     //nolint
-					wg.Add(1)
-					if service.Annotations["kube-vip.io/egress"] == "true" {
-						service.Annotations["kube-vip.io/active-endpoint"] = lastKnownGoodEndpoint
-					}
-				} else {
-					// check out previous endpoint exists
-					for x := range localendpoints {
-						if localendpoints[x] == lastKnownGoodEndpoint {
-							stillExists = true
-						}
-					}
-					if stillExists {
-						break
-					} else {
-						cancel()
-						//rw.Stop()
+			log.Debugf("[endpoint watcher] local endpoint(s) [%d], last known good [%s], active election [%t]", len(local), goodAddress, electionCancel != nil)
+
+			selected, eligible := selector.Select("", local, all, lastKnownGoodEndpoint)
+
+			if !eligible {
+				if lastKnownGoodEndpoint != nil {
+					lastKnownGoodEndpoint = nil
+					if electionCancel != nil {
+						electionCancel()
+						electionCancel = nil
 					}
+					sm.recorder.Event(service, v1.EventTypeNormal, EventReasonEndpointLost, "no local endpoints remain")
 				}
-				if !electionActive {
-					go func() {
-						// This is a blocking function, that will restart (in the event of failure)
-						for {
-							// if the context isn't cancelled restart
-							if endpointContext.Err() != context.Canceled {
-								electionActive = true
-								err = sm.StartServicesLeaderElection(endpointContext, service, wg)
-								electionActive = false
-								if err != nil {
-									log.Error(err)
-								}
-							} else {
-								electionActive = false
-								break
-							}
-						}
-						wg.Done()
-					}()
-				}
-			} else {
-				if lastKnownGoodEndpoint != "" {
-					lastKnownGoodEndpoint = ""
-					cancel()
-					//rw.Stop()
-					//return nil
-				}
+				break
 			}
 
+			if lastKnownGoodEndpoint != nil && lastKnownGoodEndpoint.Address == selected.Address {
+				break
+			}
+
+			// Either this is the first eligible candidate, or the selector
+			// picked a different one than before (the previous one stopped
+			// serving) - either way, stop any election in flight for the old
+			// candidate and start a fresh one for the new candidate, each
+			// with its own context, so the two can never be confused.
+			if electionCancel != nil {
+				electionCancel()
+			}
+			lastKnownGoodEndpoint = &selected
+
+			sm.recorder.Eventf(service, v1.EventTypeNormal, EventReasonEndpointElected, "%s/%s", id, selected.Address)
+			if service.Annotations["kube-vip.io/egress"] == "true" {
+				service.Annotations["kube-vip.io/active-endpoint"] = selected.Address
+			}
+
+			electionCtx, cancelElection := context.WithCancel(watcherCtx)
+			electionCancel = cancelElection
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer utilruntime.HandleCrash(sm.crashHandlers()...)
+				sm.recorder.Event(service, v1.EventTypeNormal, EventReasonLeaderElected, "started leader election")
+				err := sm.StartServicesLeaderElection(electionCtx, service, wg)
+				sm.recorder.Event(service, v1.EventTypeNormal, EventReasonLeaderLost, "leader election ended")
+				if err != nil {
+					utilruntime.HandleError(err)
+				}
+			}()
+
 		case watch.Deleted:
 			// Close the goroutine that will end the retry watcher, then exit the endpoint watcher function
 			close(exitFunction)
@@ -148,7 +164,8 @@ func (sm *Manager) watchEndpoint(ctx context.Context, id string, service *v1.Ser
 		case watch.Error:
 			errObject := apierrors.FromObject(event.Object)
 			statusErr, _ := errObject.(*apierrors.StatusError)
-			log.Errorf("endpoint -> %v", statusErr)
+			sm.recorder.Eventf(service, v1.EventTypeWarning, EventReasonEndpointWatchError, "%v", statusErr)
+			utilruntime.HandleError(fmt.Errorf("endpoint watch error: %v", statusErr))
 		}
 	}
 	close(exitFunction)
@@ -193,6 +210,7 @@ func (sm *Manager) updateServiceEndpointAnnotation(endpoint string, service *v1.
 	})
 
 	if retryErr != nil {
+		sm.recorder.Eventf(service, v1.EventTypeWarning, EventReasonAnnotationUpdateFailed, "%v", retryErr)
 		log.Errorf("Failed to set Services: %v", retryErr)
 		return retryErr
 	}
@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// discoveryV1Available reports whether the cluster serves the discovery.k8s.io/v1
+// EndpointSlice API. Clusters older than 1.21 (or with the API explicitly disabled)
+// only expose the legacy v1.Endpoints object, so callers should fall back to
+// watchEndpointLegacy in that case.
+func (sm *Manager) discoveryV1Available() bool {
+	resources, err := sm.clientSet.Discovery().ServerResourcesForGroupVersion(discoveryv1.SchemeGroupVersion.String())
+	if err != nil {
+		return false
+	}
+	for i := range resources.APIResources {
+		if resources.APIResources[i].Kind == "EndpointSlice" {
+			return true
+		}
+	}
+	return false
+}
+
+// desiredAddressType picks the EndpointSlice address family that should be used
+// to advertise the VIP for this Service, honouring spec.ipFamilyPolicy/ipFamilies
+// instead of blindly taking the first address returned. For a dual-stack
+// Service, IPFamilies[0] is the primary family Kubernetes assigned the
+// ClusterIP/LoadBalancer IP from, so that's the one kube-vip should track.
+func desiredAddressType(service *v1.Service) discoveryv1.AddressType {
+	if len(service.Spec.IPFamilies) > 0 && service.Spec.IPFamilies[0] == v1.IPv6Protocol {
+		return discoveryv1.AddressTypeIPv6
+	}
+	return discoveryv1.AddressTypeIPv4
+}
+
+// watchEndpointSlice watches discovery.k8s.io/v1 EndpointSlices for a Service,
+// selected via the kubernetes.io/service-name label so that multiple slices
+// belonging to the same Service are merged together. It supersedes
+// watchEndpointLegacy on clusters where the EndpointSlice API is available.
+func (sm *Manager) watchEndpointSlice(ctx context.Context, id string, service *v1.Service, wg *sync.WaitGroup) error {
+	log.Infof("[endpointslice] watching for service [%s] in namespace [%s]", service.Name, service.Namespace)
+	var cancel context.CancelFunc
+	var watcherCtx context.Context
+	watcherCtx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	selector := selectorForService(service)
+	nodeZone := sm.nodeZone(ctx, id)
+
+	// lastKnownGoodEndpoint and electionCancel are only ever touched from
+	// this event loop goroutine - the leader-election goroutine started
+	// below owns nothing but its own electionCtx, so there's no shared
+	// mutable state to race on.
+	var lastKnownGoodEndpoint *EndpointCandidate
+	var electionCancel context.CancelFunc
+
+	labelSelector := discoveryv1.LabelServiceName + "=" + service.Name
+	opts := metav1.ListOptions{
+		LabelSelector: labelSelector,
+	}
+	rw, err := watchtools.NewRetryWatcher("1", &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return sm.clientSet.DiscoveryV1().EndpointSlices(service.Namespace).Watch(ctx, opts)
+		},
+	})
+	if err != nil {
+		cancel()
+		return fmt.Errorf("error creating endpointslice watcher: %s", err.Error())
+	}
+
+	exitFunction := make(chan struct{})
+	go func() {
+		defer utilruntime.HandleCrash(sm.crashHandlers()...)
+		select {
+		case <-sm.shutdownChan:
+			log.Debug("[endpointslice] shutdown called")
+			rw.Stop()
+			cancel()
+			return
+		case <-exitFunction:
+			log.Debug("[endpointslice] function ending")
+			rw.Stop()
+			cancel()
+			return
+		}
+	}()
+
+	ch := rw.ResultChan()
+
+	addressType := desiredAddressType(service)
+	// slices merges every EndpointSlice belonging to this Service, keyed by
+	// slice name, since a Service can be spread across more than one slice.
+	slices := make(map[string]*discoveryv1.EndpointSlice)
+
+	for event := range ch {
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			slice, ok := event.Object.(*discoveryv1.EndpointSlice)
+			if !ok {
+				cancel()
+				return fmt.Errorf("unable to parse EndpointSlice from API watcher")
+			}
+			slices[slice.Name] = slice
+
+			all := candidatesFromSlices(slices, addressType)
+			local := localCandidates(all, id)
+
+			goodAddress := ""
+			if lastKnownGoodEndpoint != nil {
+				goodAddress = lastKnownGoodEndpoint.Address
+			}
+			log.Debugf("[endpointslice watcher] local endpoint(s) [%d], last known good [%s], active election [%t]", len(local), goodAddress, electionCancel != nil)
+
+			selected, eligible := selector.Select(nodeZone, local, all, lastKnownGoodEndpoint)
+
+			if !eligible {
+				if lastKnownGoodEndpoint != nil {
+					lastKnownGoodEndpoint = nil
+					if electionCancel != nil {
+						electionCancel()
+						electionCancel = nil
+					}
+					sm.recorder.Event(service, v1.EventTypeNormal, EventReasonEndpointLost, "no local endpoints remain")
+				}
+				break
+			}
+
+			if lastKnownGoodEndpoint != nil && lastKnownGoodEndpoint.Address == selected.Address {
+				break
+			}
+
+			// Either this is the first eligible candidate, or the selector
+			// picked a different one than before (the previous one stopped
+			// serving) - either way, stop any election in flight for the old
+			// candidate and start a fresh one for the new candidate, each
+			// with its own context, so the two can never be confused.
+			if electionCancel != nil {
+				electionCancel()
+			}
+			lastKnownGoodEndpoint = &selected
+
+			sm.recorder.Eventf(service, v1.EventTypeNormal, EventReasonEndpointElected, "%s/%s", id, selected.Address)
+			if service.Annotations["kube-vip.io/egress"] == "true" {
+				service.Annotations["kube-vip.io/active-endpoint"] = selected.Address
+			}
+
+			electionCtx, cancelElection := context.WithCancel(watcherCtx)
+			electionCancel = cancelElection
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer utilruntime.HandleCrash(sm.crashHandlers()...)
+				sm.recorder.Event(service, v1.EventTypeNormal, EventReasonLeaderElected, "started leader election")
+				err := sm.StartServicesLeaderElection(electionCtx, service, wg)
+				sm.recorder.Event(service, v1.EventTypeNormal, EventReasonLeaderLost, "leader election ended")
+				if err != nil {
+					utilruntime.HandleError(err)
+				}
+			}()
+
+		case watch.Deleted:
+			slice, ok := event.Object.(*discoveryv1.EndpointSlice)
+			if ok {
+				delete(slices, slice.Name)
+			}
+			if len(slices) == 0 {
+				close(exitFunction)
+				log.Infof("[endpointslice] deleted stopping watching for [%s] in namespace [%s]", service.Name, service.Namespace)
+				return nil
+			}
+		case watch.Error:
+			errObject := apierrors.FromObject(event.Object)
+			statusErr, _ := errObject.(*apierrors.StatusError)
+			sm.recorder.Eventf(service, v1.EventTypeWarning, EventReasonEndpointWatchError, "%v", statusErr)
+			utilruntime.HandleError(fmt.Errorf("endpointslice watch error: %v", statusErr))
+		}
+	}
+	close(exitFunction)
+	log.Infof("[endpointslice] stopping watching for [%s] in namespace [%s]", service.Name, service.Namespace)
+	return nil //nolint:govet
+}
@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestDesiredAddressType(t *testing.T) {
+	tests := []struct {
+		name       string
+		ipFamilies []v1.IPFamily
+		want       discoveryv1.AddressType
+	}{
+		{
+			name:       "unset defaults to IPv4",
+			ipFamilies: nil,
+			want:       discoveryv1.AddressTypeIPv4,
+		},
+		{
+			name:       "IPv4 only",
+			ipFamilies: []v1.IPFamily{v1.IPv4Protocol},
+			want:       discoveryv1.AddressTypeIPv4,
+		},
+		{
+			name:       "IPv6 only",
+			ipFamilies: []v1.IPFamily{v1.IPv6Protocol},
+			want:       discoveryv1.AddressTypeIPv6,
+		},
+		{
+			name:       "dual-stack IPv4-primary stays IPv4",
+			ipFamilies: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol},
+			want:       discoveryv1.AddressTypeIPv4,
+		},
+		{
+			name:       "dual-stack IPv6-primary follows IPv6",
+			ipFamilies: []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol},
+			want:       discoveryv1.AddressTypeIPv6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &v1.Service{Spec: v1.ServiceSpec{IPFamilies: tt.ipFamilies}}
+			if got := desiredAddressType(service); got != tt.want {
+				t.Errorf("desiredAddressType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}